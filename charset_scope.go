@@ -0,0 +1,71 @@
+package dicom
+
+import "fmt"
+
+// CodingSystem identifies the character set(s) in effect for decoding the
+// "\"-delimited string-valued elements (PN, LO, SH and the like), as
+// established by a SpecificCharacterSet (0008,0005) element. LT, ST and UT
+// values are returned as raw bytes and are not decoded under it. Terms holds the one or more
+// Defined Terms from PS3.3 C.12.1.1.2, e.g. ["", "ISO 2022 IR 87"] for a
+// Japanese value that escapes out of the default repertoire.
+type CodingSystem struct {
+	Terms []string
+}
+
+// defaultCodingSystem is in effect for any element read before the first
+// SpecificCharacterSet in its scope: the default (ASCII) repertoire.
+var defaultCodingSystem = CodingSystem{Terms: []string{""}}
+
+// parseSpecificCharacterSet extracts the CodingSystem described by a
+// SpecificCharacterSet (0008,0005) element.
+func parseSpecificCharacterSet(elem *DicomElement) (CodingSystem, error) {
+	if elem.Tag != TagSpecificCharacterSet {
+		return CodingSystem{}, fmt.Errorf("%s is not SpecificCharacterSet", elem.Tag.String())
+	}
+	if len(elem.Value) == 0 {
+		return defaultCodingSystem, nil
+	}
+	terms := make([]string, 0, len(elem.Value))
+	for _, v := range elem.Value {
+		s, ok := v.(string)
+		if !ok {
+			return CodingSystem{}, fmt.Errorf("SpecificCharacterSet value is %T, not string", v)
+		}
+		terms = append(terms, s)
+	}
+	return CodingSystem{Terms: terms}, nil
+}
+
+// codingSystemStack tracks the CodingSystem in effect at each sequence/item
+// nesting depth, so that a SpecificCharacterSet element found inside an
+// Item only governs decoding within that item, per PS3.5 C.12.1.1.2 — it
+// must not leak out to sibling items or back up to the enclosing dataset.
+// Decoder.readSequenceItem pushes a scope on entry to each item (inheriting
+// the enclosing scope) and pops it on exit; ReadDataElement consults top()
+// via Decoder.codingSystem when decoding string VRs.
+type codingSystemStack []CodingSystem
+
+// push enters a new, nested coding-system scope that starts out as "cs"
+// (readSequenceItem passes the enclosing scope's coding system) until
+// overridden by a SpecificCharacterSet element in that scope.
+func (s *codingSystemStack) push(cs CodingSystem) {
+	*s = append(*s, cs)
+}
+
+// pop leaves the innermost coding-system scope, reverting to the one
+// enclosing it.
+func (s *codingSystemStack) pop() {
+	if len(*s) == 0 {
+		return
+	}
+	*s = (*s)[:len(*s)-1]
+}
+
+// top returns the coding system in effect at the current nesting depth, and
+// false if no scope has been pushed yet.
+func (s *codingSystemStack) top() (CodingSystem, bool) {
+	if len(*s) == 0 {
+		return CodingSystem{}, false
+	}
+	return (*s)[len(*s)-1], true
+}
@@ -0,0 +1,210 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func explicitElemBytes(tag Tag, vr string, value []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, tag.Group)
+	binary.Write(&buf, binary.LittleEndian, tag.Element)
+	buf.WriteString(vr)
+	switch vr {
+	case "OB", "OW", "OF", "SQ", "UT", "UN":
+		buf.Write([]byte{0, 0})
+		binary.Write(&buf, binary.LittleEndian, uint32(len(value)))
+	default:
+		binary.Write(&buf, binary.LittleEndian, uint16(len(value)))
+	}
+	buf.Write(value)
+	return buf.Bytes()
+}
+
+func explicitUndefinedLengthSQBytes(tag Tag, body []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, tag.Group)
+	binary.Write(&buf, binary.LittleEndian, tag.Element)
+	buf.WriteString("SQ")
+	buf.Write([]byte{0, 0})
+	binary.Write(&buf, binary.LittleEndian, UndefinedLength)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func itemBytes(body []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, TagItem.Group)
+	binary.Write(&buf, binary.LittleEndian, TagItem.Element)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(body)))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func sequenceDelimiterBytes() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, tagSequenceDelimitationItem.Group)
+	binary.Write(&buf, binary.LittleEndian, tagSequenceDelimitationItem.Element)
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	return buf.Bytes()
+}
+
+// TestPerItemSpecificCharacterSetOverride builds a dataset (by hand, since
+// write.go has no charset encoder of its own) whose top-level
+// SpecificCharacterSet is ISO_IR 100, containing a sequence of per-frame
+// functional-group Items: one inherits the outer ISO_IR 100 scope, one
+// overrides to ISO 2022 IR 87 (Japanese Kanji) for just that item, and a
+// trailing top-level element confirms the override didn't leak back out
+// (PS3.5 C.12.1.1.2).
+func TestPerItemSpecificCharacterSetOverride(t *testing.T) {
+	patientName := Tag{Group: 0x0010, Element: 0x0010}
+	framesSeq := Tag{Group: 0x5200, Element: 0x9230} // Per-frame Functional Groups Sequence
+
+	latin1Jose := []byte{'J', 'o', 's', 0xE9} // "José" in ISO_IR 100 (Latin-1)
+
+	var kanji bytes.Buffer
+	kanji.WriteString("Yamada")
+	kanji.Write([]byte{0x1B, '$', 'B'}) // designate JIS X 0208 to G0
+	kanji.Write([]byte{0x3B, 0x33})     // 山 (sample table)
+	kanji.Write([]byte{0x45, 0x44})     // 田 (sample table)
+	kanji.Write([]byte{0x1B, '(', 'B'}) // back to ASCII
+
+	item1 := itemBytes(explicitElemBytes(patientName, "PN", latin1Jose))
+	item2 := itemBytes(bytes.Join([][]byte{
+		explicitElemBytes(TagSpecificCharacterSet, "CS", []byte("ISO 2022 IR 87")),
+		explicitElemBytes(patientName, "PN", kanji.Bytes()),
+	}, nil))
+	seqBody := bytes.Join([][]byte{item1, item2, sequenceDelimiterBytes()}, nil)
+
+	dataset := bytes.Join([][]byte{
+		explicitElemBytes(TagSpecificCharacterSet, "CS", []byte("ISO_IR 100")),
+		explicitUndefinedLengthSQBytes(framesSeq, seqBody),
+		explicitElemBytes(patientName, "PN", latin1Jose),
+	}, nil)
+
+	metaOnly := &DicomFile{Elements: []DicomElement{
+		{Tag: TagTransferSyntaxUID, Vr: "UI", Value: []interface{}{ExplicitVRLittleEndian}},
+	}}
+	header, err := WriteBytes(metaOnly, nil)
+	if err != nil {
+		t.Fatalf("WriteBytes(meta): %v", err)
+	}
+	full := append(header, dataset...)
+
+	parsed, err := ParseBytes(full)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+
+	seqElem, err := LookupElementByTag(parsed.Elements, framesSeq)
+	if err != nil {
+		t.Fatalf("lookup frames sequence: %v", err)
+	}
+	if len(seqElem.Value) != 2 {
+		t.Fatalf("got %d items, want 2", len(seqElem.Value))
+	}
+
+	getPN := func(item *DicomElement) string {
+		t.Helper()
+		for _, v := range item.Value {
+			nested, ok := v.(*DicomElement)
+			if !ok {
+				continue
+			}
+			if nested.Tag == patientName {
+				s, err := nested.GetString()
+				if err != nil {
+					t.Fatalf("PatientName.GetString: %v", err)
+				}
+				return s
+			}
+		}
+		t.Fatal("item has no PatientName element")
+		return ""
+	}
+
+	item1Elem, ok := seqElem.Value[0].(*DicomElement)
+	if !ok {
+		t.Fatalf("item 0 is %T, not *DicomElement", seqElem.Value[0])
+	}
+	if got, want := getPN(item1Elem), "José"; got != want {
+		t.Errorf("item 0 (inherits ISO_IR 100) PatientName = %q, want %q", got, want)
+	}
+
+	item2Elem, ok := seqElem.Value[1].(*DicomElement)
+	if !ok {
+		t.Fatalf("item 1 is %T, not *DicomElement", seqElem.Value[1])
+	}
+	if got, want := getPN(item2Elem), "Yamada山田"; got != want {
+		t.Errorf("item 1 (overrides ISO 2022 IR 87) PatientName = %q, want %q", got, want)
+	}
+
+	trailing, err := LookupElementByTag(parsed.Elements, patientName)
+	if err != nil {
+		t.Fatalf("lookup trailing PatientName: %v", err)
+	}
+	if got, want := trailing.Value[0].(string), "José"; got != want {
+		t.Errorf("trailing top-level PatientName = %q, want %q (ISO 2022 IR 87 override must not leak out of its item)", got, want)
+	}
+}
+
+// TestKoreanCodingSystemOverride exercises the G1/SO-SI locking-shift half
+// of ISO 2022 decoding (used by ISO 2022 IR 149, Korean), as opposed to
+// the G0-redesignation half ISO 2022 IR 87 uses.
+func TestKoreanCodingSystemOverride(t *testing.T) {
+	patientName := Tag{Group: 0x0010, Element: 0x0010}
+
+	var hangul bytes.Buffer
+	hangul.WriteString("Kim")
+	hangul.Write([]byte{0x1B, '$', ')', 'C'}) // designate KS X 1001 to G1
+	hangul.WriteByte(0x0E)                    // SO: lock to G1
+	hangul.Write([]byte{0x31, 0x68})          // 김 (sample table)
+	hangul.Write([]byte{0x3C, 0x76})          // 수 (sample table)
+	hangul.WriteByte(0x0F)                    // SI: lock back to G0
+
+	item := itemBytes(bytes.Join([][]byte{
+		explicitElemBytes(TagSpecificCharacterSet, "CS", []byte("ISO 2022 IR 149")),
+		explicitElemBytes(patientName, "PN", hangul.Bytes()),
+	}, nil))
+	seqTag := Tag{Group: 0x5200, Element: 0x9230}
+	seqBody := bytes.Join([][]byte{item, sequenceDelimiterBytes()}, nil)
+
+	dataset := bytes.Join([][]byte{
+		explicitElemBytes(TagSpecificCharacterSet, "CS", []byte("ISO_IR 100")),
+		explicitUndefinedLengthSQBytes(seqTag, seqBody),
+	}, nil)
+
+	metaOnly := &DicomFile{Elements: []DicomElement{
+		{Tag: TagTransferSyntaxUID, Vr: "UI", Value: []interface{}{ExplicitVRLittleEndian}},
+	}}
+	header, err := WriteBytes(metaOnly, nil)
+	if err != nil {
+		t.Fatalf("WriteBytes(meta): %v", err)
+	}
+	full := append(header, dataset...)
+
+	parsed, err := ParseBytes(full)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+
+	seqElem, err := LookupElementByTag(parsed.Elements, seqTag)
+	if err != nil {
+		t.Fatalf("lookup sequence: %v", err)
+	}
+	itemElem, ok := seqElem.Value[0].(*DicomElement)
+	if !ok {
+		t.Fatalf("item 0 is %T, not *DicomElement", seqElem.Value[0])
+	}
+	var got string
+	for _, v := range itemElem.Value {
+		nested, ok := v.(*DicomElement)
+		if ok && nested.Tag == patientName {
+			got, _ = nested.GetString()
+		}
+	}
+	if want := "Kim김수"; got != want {
+		t.Errorf("PatientName = %q, want %q", got, want)
+	}
+}
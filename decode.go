@@ -0,0 +1,514 @@
+package dicom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// UndefinedLength is the 32-bit length value that marks a sequence, or an
+// encapsulated (compressed) PixelData element, as having no declared
+// length; such elements are terminated by an explicit delimitation item
+// instead (PS3.5 7.1.1).
+const UndefinedLength uint32 = 0xFFFFFFFF
+
+// ExplicitVR and ImplicitVR are the two values NewDecoder/PushTransferSyntax
+// take for their "implicit" parameter.
+const (
+	ExplicitVR = false
+	ImplicitVR = true
+)
+
+// transferSyntaxState is one entry of the decoder's transfer-syntax stack.
+type transferSyntaxState struct {
+	bo       binary.ByteOrder
+	implicit bool
+}
+
+// Decoder reads DICOM-encoded bytes off an io.Reader, tracking the
+// transfer syntax and SpecificCharacterSet scope currently in effect.
+// Decoder, Tag (tag.go), and the data dictionaries (dictionary.go) are the
+// shared foundation that Parse/ParseWithOptions/Parser/Write all build on.
+type Decoder struct {
+	r             *bufio.Reader
+	bytesLeft     int64
+	tsStack       []transferSyntaxState
+	csStack       codingSystemStack
+	unknownTagVR  string
+	dropPixelData bool
+	err           error
+}
+
+// NewDecoder creates a Decoder reading up to "bytes" bytes from "in",
+// initially under byte order "bo" and VR style "implicit". ParseWithOptions/
+// NewParser use this for the 128-byte preamble and file meta group
+// (always ExplicitVR LittleEndian per PS3.10), then call PushTransferSyntax
+// once the dataset's own transfer syntax is known.
+func NewDecoder(in io.Reader, bytes int64, bo binary.ByteOrder, implicit bool) *Decoder {
+	return &Decoder{
+		r:            bufio.NewReader(in),
+		bytesLeft:    bytes,
+		tsStack:      []transferSyntaxState{{bo: bo, implicit: implicit}},
+		csStack:      codingSystemStack{defaultCodingSystem},
+		unknownTagVR: "OW",
+	}
+}
+
+// SetUnknownTagVR overrides the VR ReadDataElement's implicit-VR fallback
+// assumes for a tag that isn't in the data dictionary and has a defined
+// (not UndefinedLength) length. NewDecoder defaults this to "OW", since
+// private/vendor tags are almost always binary and decoding them as a
+// string list can corrupt them.
+func (d *Decoder) SetUnknownTagVR(vr string) {
+	d.unknownTagVR = vr
+}
+
+// SetDropPixelData tells ReadDataElement to discard PixelData (7FE0,0010)
+// bytes off the stream without allocating or retaining them, rather than
+// materializing the element and letting the caller throw the result away.
+func (d *Decoder) SetDropPixelData(drop bool) {
+	d.dropPixelData = drop
+}
+
+// discard consumes and throws away the next n bytes of the stream, without
+// allocating a buffer for them.
+func (d *Decoder) discard(n int) {
+	if n <= 0 {
+		return
+	}
+	discarded, err := d.r.Discard(n)
+	d.bytesLeft -= int64(discarded)
+	if err != nil {
+		d.SetError(err)
+	}
+}
+
+func (d *Decoder) current() transferSyntaxState {
+	return d.tsStack[len(d.tsStack)-1]
+}
+
+// PushTransferSyntax switches the decoder to a new byte order/VR style,
+// remembering the previous one so PopTransferSyntax can restore it.
+func (d *Decoder) PushTransferSyntax(bo binary.ByteOrder, implicit bool) {
+	d.tsStack = append(d.tsStack, transferSyntaxState{bo: bo, implicit: implicit})
+}
+
+// PopTransferSyntax reverts to the transfer syntax in effect before the
+// matching PushTransferSyntax.
+func (d *Decoder) PopTransferSyntax() {
+	if len(d.tsStack) <= 1 {
+		return
+	}
+	d.tsStack = d.tsStack[:len(d.tsStack)-1]
+}
+
+// SetCodingSystem sets the CodingSystem for the current nesting scope: the
+// dataset's top level, or the innermost Item if called while one is being
+// read.
+func (d *Decoder) SetCodingSystem(cs CodingSystem) {
+	d.csStack[len(d.csStack)-1] = cs
+}
+
+func (d *Decoder) codingSystem() CodingSystem {
+	cs, ok := d.csStack.top()
+	if !ok {
+		return defaultCodingSystem
+	}
+	return cs
+}
+
+// Len reports how many bytes remain to be read from the stream.
+func (d *Decoder) Len() int64 {
+	return d.bytesLeft
+}
+
+// Error returns the first error encountered by the decoder, if any.
+func (d *Decoder) Error() error {
+	return d.err
+}
+
+// SetError records "err" as the decoder's terminal error, if one isn't
+// already set.
+func (d *Decoder) SetError(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// Finish returns the decoder's terminal error, treating io.EOF reached
+// exactly at a read boundary as a clean end of stream.
+func (d *Decoder) Finish() error {
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
+
+// Peek returns up to "n" bytes from the stream without consuming them.
+func (d *Decoder) Peek(n int) ([]byte, error) {
+	b, err := d.r.Peek(n)
+	if err != nil && len(b) == 0 {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (d *Decoder) readFull(p []byte) error {
+	n, err := io.ReadFull(d.r, p)
+	d.bytesLeft -= int64(n)
+	if err != nil {
+		d.SetError(err)
+	}
+	return err
+}
+
+func (d *Decoder) readBytes(n int) []byte {
+	b := make([]byte, n)
+	if err := d.readFull(b); err != nil {
+		return nil
+	}
+	return b
+}
+
+func (d *Decoder) readUint16() uint16 {
+	b := d.readBytes(2)
+	if d.Error() != nil {
+		return 0
+	}
+	return d.current().bo.Uint16(b)
+}
+
+func (d *Decoder) readUint32() uint32 {
+	b := d.readBytes(4)
+	if d.Error() != nil {
+		return 0
+	}
+	return d.current().bo.Uint32(b)
+}
+
+// readTagAndLength reads a bare tag+4-byte-length pair, with no VR field.
+// Item, ItemDelimitationItem, and SequenceDelimitationItem are always
+// encoded this way, regardless of transfer syntax.
+func (d *Decoder) readTagAndLength() (Tag, uint32) {
+	group := d.readUint16()
+	element := d.readUint16()
+	length := d.readUint32()
+	return Tag{Group: group, Element: element}, length
+}
+
+func (d *Decoder) peekIsItemDelimitation() bool {
+	b, err := d.Peek(4)
+	if err != nil || len(b) < 4 {
+		return false
+	}
+	bo := d.current().bo
+	tag := Tag{Group: bo.Uint16(b[0:2]), Element: bo.Uint16(b[2:4])}
+	return tag == tagItemDelimitationItem
+}
+
+// ParseFileHeader reads the 128-byte preamble, the "DICM" magic, and the
+// file meta group (0002,xxxx), which per PS3.10 is always encoded
+// ExplicitVR LittleEndian and always opens with a (0002,0000) group length
+// that bounds how many of the following bytes belong to the group. If the
+// stream does not open with a preamble and "DICM" magic, it consumes
+// nothing and returns no elements, so the caller can infer the dataset's
+// transfer syntax from its leading bytes.
+func ParseFileHeader(buffer *Decoder) []DicomElement {
+	if head, err := buffer.Peek(132); err != nil || len(head) < 132 || string(head[128:132]) != "DICM" {
+		return nil
+	}
+	buffer.readBytes(128)
+	if buffer.Error() != nil {
+		return nil
+	}
+	magic := buffer.readBytes(4)
+	if buffer.Error() != nil {
+		return nil
+	}
+	if string(magic) != "DICM" {
+		buffer.SetError(fmt.Errorf("not a DICOM file: missing DICM magic"))
+		return nil
+	}
+
+	groupLengthElem := ReadDataElement(buffer)
+	if buffer.Error() != nil {
+		return nil
+	}
+	if groupLengthElem.Tag != tagFileMetaGroupLength {
+		buffer.SetError(fmt.Errorf("file meta header: expected (0002,0000) group length, got %s", groupLengthElem.Tag.String()))
+		return nil
+	}
+	groupLength, ok := groupLengthElem.Value[0].(uint32)
+	if !ok {
+		buffer.SetError(fmt.Errorf("file meta header: group length value is %T, not uint32", groupLengthElem.Value[0]))
+		return nil
+	}
+
+	var elems []DicomElement
+	metaStart := buffer.bytesLeft
+	for metaStart-buffer.bytesLeft < int64(groupLength) {
+		elem := ReadDataElement(buffer)
+		if buffer.Error() != nil {
+			break
+		}
+		elems = append(elems, *elem)
+	}
+	return elems
+}
+
+// ReadDataElement reads one data element (tag, VR/length header, and
+// value) from "d", honoring the transfer syntax and SpecificCharacterSet
+// scope currently in effect. It always returns a non-nil *DicomElement;
+// callers must check d.Error() before trusting the result.
+func ReadDataElement(d *Decoder) *DicomElement {
+	ts := d.current()
+	group := d.readUint16()
+	element := d.readUint16()
+	if d.Error() != nil {
+		return &DicomElement{}
+	}
+	tag := Tag{Group: group, Element: element}
+
+	if tag == tagItemDelimitationItem || tag == tagSequenceDelimitationItem {
+		vl := d.readUint32()
+		return &DicomElement{Tag: tag, Vr: "NA", Vl: vl}
+	}
+
+	var vr string
+	var vl uint32
+	if ts.implicit {
+		vl = d.readUint32()
+		if d.Error() != nil {
+			return &DicomElement{Tag: tag}
+		}
+		if info, err := LookupTagByTag(tag); err == nil {
+			vr = info.VR
+		} else if vl == UndefinedLength {
+			vr = "SQ"
+		} else {
+			// Unknown (private/vendor) tag with a defined length:
+			// the data dictionary can't tell us its VR, so fall back
+			// to d.unknownTagVR (see SetUnknownTagVR).
+			vr = d.unknownTagVR
+		}
+	} else {
+		vrBytes := d.readBytes(2)
+		if d.Error() != nil {
+			return &DicomElement{Tag: tag}
+		}
+		vr = string(vrBytes)
+		switch vr {
+		case "OB", "OW", "OF", "SQ", "UT", "UN":
+			d.readBytes(2) // reserved
+			vl = d.readUint32()
+		default:
+			vl = uint32(d.readUint16())
+		}
+		if d.Error() != nil {
+			return &DicomElement{Tag: tag, Vr: vr}
+		}
+	}
+
+	elem := &DicomElement{Tag: tag, Vr: vr, Vl: vl}
+	if tag == TagPixelData && d.dropPixelData {
+		if vl == UndefinedLength {
+			d.discardEncapsulatedPixelData()
+		} else {
+			d.discard(int(vl))
+		}
+		return elem
+	}
+	switch {
+	case vr == "SQ":
+		elem.Value = d.readSequence(vl)
+	case (vr == "OB" || vr == "OW" || vr == "UN") && vl == UndefinedLength:
+		elem.Value = d.readEncapsulatedPixelData()
+	default:
+		elem.Value = d.readValue(vr, vl)
+	}
+	return elem
+}
+
+// readSequence reads a SQ element's items, each holding nested elements,
+// per PS3.5 7.5.
+func (d *Decoder) readSequence(vl uint32) []interface{} {
+	var items []interface{}
+	start := d.bytesLeft
+	for vl == UndefinedLength || start-d.bytesLeft < int64(vl) {
+		tag, itemLen := d.readTagAndLength()
+		if d.Error() != nil {
+			break
+		}
+		if tag == tagSequenceDelimitationItem {
+			break
+		}
+		if tag != TagItem {
+			d.SetError(fmt.Errorf("expected Item tag inside sequence, found %s", tag.String()))
+			break
+		}
+		items = append(items, d.readSequenceItem(itemLen))
+		if d.Error() != nil {
+			break
+		}
+	}
+	return items
+}
+
+// readSequenceItem reads the nested elements of one SQ item, scoping any
+// SpecificCharacterSet found inside to just this item (PS3.5 C.12.1.1.2).
+func (d *Decoder) readSequenceItem(vl uint32) *DicomElement {
+	d.csStack.push(d.codingSystem())
+	defer d.csStack.pop()
+
+	item := &DicomElement{Tag: TagItem, Vr: "NA", Vl: vl}
+	start := d.bytesLeft
+	for {
+		if vl != UndefinedLength && start-d.bytesLeft >= int64(vl) {
+			break
+		}
+		if vl == UndefinedLength && d.peekIsItemDelimitation() {
+			d.readTagAndLength() // consume the delimitation item
+			break
+		}
+		elem := ReadDataElement(d)
+		if d.Error() != nil {
+			break
+		}
+		if elem.Tag == TagSpecificCharacterSet {
+			cs, err := parseSpecificCharacterSet(elem)
+			if err != nil {
+				d.SetError(err)
+				break
+			}
+			d.SetCodingSystem(cs)
+		}
+		item.Value = append(item.Value, elem)
+	}
+	return item
+}
+
+// readEncapsulatedPixelData reads the items of a compressed PixelData
+// element: each item's body is raw (not further-decoded) bytes, per
+// PS3.5 A.4. The outer element always has an undefined length, so this
+// reads until SequenceDelimitationItem.
+func (d *Decoder) readEncapsulatedPixelData() []interface{} {
+	var items []interface{}
+	for {
+		tag, itemLen := d.readTagAndLength()
+		if d.Error() != nil {
+			break
+		}
+		if tag == tagSequenceDelimitationItem {
+			break
+		}
+		if tag != TagItem {
+			d.SetError(fmt.Errorf("expected Item tag inside encapsulated PixelData, found %s", tag.String()))
+			break
+		}
+		raw := d.readBytes(int(itemLen))
+		if d.Error() != nil {
+			break
+		}
+		items = append(items, &DicomElement{Tag: TagItem, Vr: "NA", Vl: itemLen, Value: []interface{}{raw}})
+	}
+	return items
+}
+
+// discardEncapsulatedPixelData walks a compressed PixelData element's items
+// the same way readEncapsulatedPixelData does, but throws away each item's
+// bytes instead of retaining them, for SetDropPixelData(true).
+func (d *Decoder) discardEncapsulatedPixelData() {
+	for {
+		tag, itemLen := d.readTagAndLength()
+		if d.Error() != nil {
+			return
+		}
+		if tag == tagSequenceDelimitationItem {
+			return
+		}
+		if tag != TagItem {
+			d.SetError(fmt.Errorf("expected Item tag inside encapsulated PixelData, found %s", tag.String()))
+			return
+		}
+		d.discard(int(itemLen))
+		if d.Error() != nil {
+			return
+		}
+	}
+}
+
+// readValue decodes a non-sequence element's value according to "vr".
+func (d *Decoder) readValue(vr string, vl uint32) []interface{} {
+	if vl == UndefinedLength {
+		d.SetError(fmt.Errorf("VR %s does not support an undefined length", vr))
+		return nil
+	}
+	raw := d.readBytes(int(vl))
+	if d.Error() != nil {
+		return nil
+	}
+
+	bo := d.current().bo
+	switch vr {
+	case "OB", "OW", "OF", "UN", "LT", "ST", "UT":
+		return []interface{}{raw}
+	case "AT":
+		var tags []interface{}
+		for i := 0; i+4 <= len(raw); i += 4 {
+			tags = append(tags, Tag{Group: bo.Uint16(raw[i : i+2]), Element: bo.Uint16(raw[i+2 : i+4])})
+		}
+		return tags
+	case "US":
+		var vals []interface{}
+		for i := 0; i+2 <= len(raw); i += 2 {
+			vals = append(vals, bo.Uint16(raw[i:i+2]))
+		}
+		return vals
+	case "UL":
+		var vals []interface{}
+		for i := 0; i+4 <= len(raw); i += 4 {
+			vals = append(vals, bo.Uint32(raw[i:i+4]))
+		}
+		return vals
+	case "SS":
+		var vals []interface{}
+		for i := 0; i+2 <= len(raw); i += 2 {
+			vals = append(vals, int16(bo.Uint16(raw[i:i+2])))
+		}
+		return vals
+	case "SL":
+		var vals []interface{}
+		for i := 0; i+4 <= len(raw); i += 4 {
+			vals = append(vals, int32(bo.Uint32(raw[i:i+4])))
+		}
+		return vals
+	case "FL":
+		var vals []interface{}
+		for i := 0; i+4 <= len(raw); i += 4 {
+			vals = append(vals, math.Float32frombits(bo.Uint32(raw[i:i+4])))
+		}
+		return vals
+	case "FD":
+		var vals []interface{}
+		for i := 0; i+8 <= len(raw); i += 8 {
+			vals = append(vals, math.Float64frombits(bo.Uint64(raw[i:i+8])))
+		}
+		return vals
+	default:
+		// CS, SH, LO, PN, DA, TM, UI, etc: PS3.5 6.4 string VRs, one or
+		// more values separated by "\", decoded per d.codingSystem()
+		// (PS3.5 6.1.2.3, C.12.1.1.2). Padding is always encoded in the
+		// single-byte default repertoire, so it's safe to trim at the
+		// byte level before charset-aware decoding.
+		trimmed := bytes.TrimRight(raw, " \x00")
+		parts := decodeStringValues(trimmed, d.codingSystem())
+		vals := make([]interface{}, len(parts))
+		for i, p := range parts {
+			vals[i] = p
+		}
+		return vals
+	}
+}
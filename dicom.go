@@ -26,6 +26,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log"
+
+	"github.com/gillesdemey/go-dicom/pkg/frame"
 )
 
 // UID prefix provided by https://www.medicalconnections.co.uk/Free_UID
@@ -86,32 +89,226 @@ type DicomElement struct {
 	Value []interface{} // Value Multiplicity PS 3.5 6.4
 }
 
+// GetString returns the element's sole value as a string, or an error if
+// the element is empty, holds more than one value, or its value isn't a
+// string (e.g. a binary VR like OB/OW, or a numeric VR like US/UL).
+func (e *DicomElement) GetString() (string, error) {
+	if len(e.Value) != 1 {
+		return "", fmt.Errorf("%s: expected a single value, got %d", e.Tag.String(), len(e.Value))
+	}
+	s, ok := e.Value[0].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: value is %T, not a string", e.Tag.String(), e.Value[0])
+	}
+	return s, nil
+}
+
 // ParseBytes(buf) is a shorthand for Parse(bytes.NewBuffer(buf), len(buf)).
 func ParseBytes(data []byte) (*DicomFile, error) {
 	return Parse(bytes.NewBuffer(data), int64(len(data)))
 }
 
+// ParseOptions controls how Parse/ParseWithOptions materialize a DicomFile.
+// The zero value preserves the historical behavior: every element is parsed
+// and appended to DicomFile.Elements.
+type ParseOptions struct {
+	// DropPixelData, when true, causes the bulk data of the PixelData
+	// element (7FE0,0010) to be skipped off the stream without ever being
+	// allocated or materialized, rather than read into memory and then
+	// discarded. This is useful for callers that only care about
+	// metadata (e.g. indexing a PACS archive) and don't want to pay the
+	// memory/IO cost of large pixel payloads.
+	//
+	// Together with FrameChannel, PixelData is still read in full, since
+	// splitting it into frames requires its bytes; DropPixelData then only
+	// keeps the element out of DicomFile.Elements.
+	DropPixelData bool
+
+	// ReturnTags, if non-empty, restricts DicomFile.Elements to only the
+	// listed tags. Elements not in this list are still consumed from the
+	// stream (to keep byte offsets consistent) but are not appended to
+	// the result.
+	ReturnTags []Tag
+
+	// StopAtTag, if non-zero, halts parsing as soon as an element with a
+	// tag greater than or equal to StopAtTag is encountered. The
+	// triggering element is not included in the result.
+	StopAtTag Tag
+
+	// FrameChannel, if set, causes PixelData (7FE0,0010) to be split into
+	// individual frames and pushed onto the channel, and the channel is
+	// closed once Parse returns (including on error). This is NOT
+	// incremental: PixelData is still fully read off the wire by
+	// ReadDataElement before being split and pushed, so it does not by
+	// itself reduce peak memory use. Set DropPixelData too if you don't
+	// also need the raw element in DicomFile.Elements.
+	FrameChannel chan *frame.Frame
+
+	// UnknownTagVR overrides the VR the implicit-VR reader path assumes
+	// for a tag that isn't in the data dictionary and has a defined (not
+	// 0xFFFFFFFF) length. Defaults to "OW": private/vendor tags are
+	// almost always binary, and decoding them as a string list can
+	// corrupt them (embedded NULs get truncated, and the bytes may not
+	// even be valid UTF-8).
+	UnknownTagVR string
+}
+
+// unknownTagVR returns the VR ParseOptions says to use for an
+// unrecognized, defined-length tag, defaulting to "OW". It's consulted by
+// ReadDataElement's implicit-VR fallback via Decoder.SetUnknownTagVR.
+func (opts *ParseOptions) unknownTagVR() string {
+	if opts != nil && opts.UnknownTagVR != "" {
+		return opts.UnknownTagVR
+	}
+	return "OW"
+}
+
+// shouldReturnTag reports whether "tag" passes the ReturnTags filter in
+// "opts". A nil or empty ReturnTags means all tags pass.
+func (opts *ParseOptions) shouldReturnTag(tag Tag) bool {
+	if opts == nil || len(opts.ReturnTags) == 0 {
+		return true
+	}
+	for _, t := range opts.ReturnTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tagGreaterOrEqual reports whether a >= b in (group, element) order.
+func tagGreaterOrEqual(a, b Tag) bool {
+	if a.Group != b.Group {
+		return a.Group > b.Group
+	}
+	return a.Element >= b.Element
+}
+
+// peekAmount is the number of leading bytes of the dataset inspected when
+// opportunistically guessing a transfer syntax for a file whose meta header
+// is missing or carries no TransferSyntaxUID.
+const peekAmount = 100
+
+// transferSyntaxCandidate is one (byte order, VR style) combination tried
+// when inferring a missing transfer syntax.
+type transferSyntaxCandidate struct {
+	endian   binary.ByteOrder
+	implicit bool
+	uid      string
+}
+
+var transferSyntaxCandidates = []transferSyntaxCandidate{
+	{binary.LittleEndian, true, ImplicitVRLittleEndian},
+	{binary.LittleEndian, false, ExplicitVRLittleEndian},
+	{binary.BigEndian, false, ExplicitVRBigEndian},
+}
+
+// inferTransferSyntax is used when a file's meta header doesn't carry a
+// usable TransferSyntaxUID. It peeks at the next peekAmount bytes of
+// "buffer" (without consuming them) and trial-decodes the first data
+// element under each of the standard transfer syntaxes, accepting the
+// first candidate whose result looks plausible. It falls back to
+// LittleEndian implicit VR, with a warning, if no candidate looks right.
+func inferTransferSyntax(buffer *Decoder) (bo binary.ByteOrder, implicit bool, uid string, err error) {
+	peeked, err := buffer.Peek(peekAmount)
+	if err != nil && len(peeked) == 0 {
+		return nil, false, "", fmt.Errorf("could not peek stream to infer transfer syntax: %v", err)
+	}
+	for _, cand := range transferSyntaxCandidates {
+		if looksLikeValidElement(peeked, cand) {
+			return cand.endian, cand.implicit, cand.uid, nil
+		}
+	}
+	log.Printf("dicom.Parse: no file meta information found and no transfer syntax could be inferred; assuming %s", ImplicitVRLittleEndian)
+	return binary.LittleEndian, true, ImplicitVRLittleEndian, nil
+}
+
+// looksLikeValidElement trial-decodes the first data element of "peeked"
+// as candidate "cand" and reports whether the result looks like a real
+// DICOM element: a tag with a plausible group, a valid VR string for
+// explicit encodings, and a length that fits within the bytes available.
+func looksLikeValidElement(peeked []byte, cand transferSyntaxCandidate) bool {
+	if len(peeked) < 8 {
+		return false
+	}
+	trial := NewDecoder(bytes.NewReader(peeked), int64(len(peeked)), cand.endian, cand.implicit)
+	elem := ReadDataElement(trial)
+	if trial.Error() != nil {
+		return false
+	}
+	if elem.Tag.Group > 0x7FFF {
+		if _, err := LookupTagByTag(elem.Tag); err != nil {
+			return false
+		}
+	}
+	if !cand.implicit && !isValidVR(elem.Vr) {
+		return false
+	}
+	return true
+}
+
+// standardVRs is the set of two-letter VR codes defined by DICOM PS3.5
+// 6.2, used to sanity-check a trial-decoded element.
+var standardVRs = map[string]bool{
+	"AE": true, "AS": true, "AT": true, "CS": true, "DA": true, "DS": true,
+	"DT": true, "FL": true, "FD": true, "IS": true, "LO": true, "LT": true,
+	"OB": true, "OF": true, "OW": true, "PN": true, "SH": true, "SL": true,
+	"SQ": true, "SS": true, "ST": true, "TM": true, "UI": true, "UL": true,
+	"UN": true, "US": true, "UT": true,
+}
+
+func isValidVR(vr string) bool {
+	return standardVRs[vr]
+}
+
 // Parse a DICOM file stored in "io", up to "bytes". Returns a DICOM file struct
 func Parse(in io.Reader, bytes int64) (*DicomFile, error) {
+	return ParseWithOptions(in, bytes, nil)
+}
+
+// ParseWithOptions is like Parse, but "opts" (which may be nil) controls
+// pixel-data materialization, tag filtering, and early termination. See
+// ParseOptions for details.
+func ParseWithOptions(in io.Reader, bytes int64, opts *ParseOptions) (*DicomFile, error) {
 	buffer := NewDecoder(in, bytes, binary.LittleEndian, ExplicitVR)
+	buffer.SetUnknownTagVR(opts.unknownTagVR())
+	if opts != nil && opts.DropPixelData && opts.FrameChannel == nil {
+		buffer.SetDropPixelData(true)
+	}
+	if opts != nil && opts.FrameChannel != nil {
+		defer close(opts.FrameChannel)
+	}
 	metaElems := ParseFileHeader(buffer)
 	if buffer.Error() != nil {
 		return nil, buffer.Error()
 	}
 	file := &DicomFile{Elements: metaElems}
 
-	// Change the transfer syntax for the rest of the file.
-	elem, err := LookupElementByTag(metaElems, TagTransferSyntaxUID)
-	if err != nil {
-		return nil, err
-	}
-	transferSyntaxUID, err := elem.GetString()
-	if err != nil {
-		return nil, err
-	}
-	endian, implicit, err := ParseTransferSyntaxUID(transferSyntaxUID)
-	if err != nil {
-		return nil, err
+	// Change the transfer syntax for the rest of the file. Conformant
+	// files always carry this in the meta header; some older modalities
+	// omit the meta header entirely, so we fall back to inferring it
+	// from the leading bytes of the dataset itself.
+	var endian binary.ByteOrder
+	var implicit bool
+	var transferSyntaxUID string
+	var frameGeometry []DicomElement
+	if elem, lookupErr := LookupElementByTag(metaElems, TagTransferSyntaxUID); lookupErr == nil {
+		var err error
+		transferSyntaxUID, err = elem.GetString()
+		if err != nil {
+			return nil, err
+		}
+		endian, implicit, err = ParseTransferSyntaxUID(transferSyntaxUID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		endian, implicit, transferSyntaxUID, err = inferTransferSyntax(buffer)
+		if err != nil {
+			return nil, err
+		}
 	}
 	buffer.PushTransferSyntax(endian, implicit)
 	defer buffer.PopTransferSyntax()
@@ -122,11 +319,15 @@ func Parse(in io.Reader, bytes int64) (*DicomFile, error) {
 		if buffer.Error() != nil {
 			break
 		}
+		if opts != nil && opts.StopAtTag != (Tag{}) && tagGreaterOrEqual(elem.Tag, opts.StopAtTag) {
+			break
+		}
 		if elem.Tag == TagSpecificCharacterSet {
-			// TODO(saito) SpecificCharacterSet may appear in a
-			// middle of a SQ or NA.  In such case, the charset seem
-			// to be scoped inside the SQ or NA. So we need to make
-			// the charset a stack.
+			// This only sets the charset for the top-level dataset
+			// scope. A SpecificCharacterSet nested inside a sequence
+			// Item is scoped to that item alone; Decoder.readSequenceItem
+			// pushes and pops its own scope for that case (PS3.5
+			// C.12.1.1.2).
 			cs, err := parseSpecificCharacterSet(elem)
 			if err != nil {
 				buffer.SetError(err)
@@ -134,11 +335,238 @@ func Parse(in io.Reader, bytes int64) (*DicomFile, error) {
 				buffer.SetCodingSystem(cs)
 			}
 		}
+		switch elem.Tag {
+		case TagRows, TagColumns, TagSamplesPerPixel, TagBitsAllocated:
+			frameGeometry = append(frameGeometry, *elem)
+		}
+		if elem.Tag == TagPixelData && opts != nil && opts.FrameChannel != nil {
+			if ferr := emitFrames(opts.FrameChannel, elem, frameGeometry, transferSyntaxUID, endian); ferr != nil {
+				buffer.SetError(ferr)
+				break
+			}
+		}
+		if opts != nil && opts.DropPixelData && elem.Tag == TagPixelData {
+			continue
+		}
+		if !opts.shouldReturnTag(elem.Tag) {
+			continue
+		}
 		file.Elements = append(file.Elements, *elem)
 	}
 	return file, buffer.Finish()
 }
 
+// emitFrames splits the PixelData element "elem" into individual frames and
+// pushes them onto "ch". "priorElements" holds the Rows/Columns/
+// SamplesPerPixel/BitsAllocated elements parsed so far in the current
+// dataset (whether or not ReturnTags keeps them in DicomFile.Elements),
+// which by convention always precede PixelData.
+func emitFrames(ch chan *frame.Frame, elem *DicomElement, priorElements []DicomElement, transferSyntaxUID string, endian binary.ByteOrder) error {
+	if elem.Vl == UndefinedLength {
+		frames, err := extractEncapsulatedFrames(elem, transferSyntaxUID)
+		if err != nil {
+			return err
+		}
+		for _, f := range frames {
+			ch <- f
+		}
+		return nil
+	}
+	rows, err := lookupIntElement(priorElements, TagRows)
+	if err != nil {
+		return err
+	}
+	cols, err := lookupIntElement(priorElements, TagColumns)
+	if err != nil {
+		return err
+	}
+	samplesPerPixel, err := lookupIntElement(priorElements, TagSamplesPerPixel)
+	if err != nil {
+		return err
+	}
+	bitsAllocated, err := lookupIntElement(priorElements, TagBitsAllocated)
+	if err != nil {
+		return err
+	}
+	frames, err := extractNativeFrames(elem, rows, cols, samplesPerPixel, bitsAllocated, endian)
+	if err != nil {
+		return err
+	}
+	for _, f := range frames {
+		ch <- f
+	}
+	return nil
+}
+
+// extractNativeFrames splits a native (uncompressed) PixelData element's
+// raw bytes into one frame per Rows*Cols*SamplesPerPixel*BitsAllocated/8
+// bytes, decoding samples with "endian" (the dataset's actual transfer
+// syntax byte order — native PixelData, unlike encapsulated PixelData's
+// Basic Offset Table, is encoded in the dataset's own byte order).
+func extractNativeFrames(elem *DicomElement, rows, cols, samplesPerPixel, bitsAllocated int, endian binary.ByteOrder) ([]*frame.Frame, error) {
+	if len(elem.Value) != 1 {
+		return nil, fmt.Errorf("native PixelData: expected a single raw value, got %d", len(elem.Value))
+	}
+	data, ok := elem.Value[0].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("native PixelData: value is %T, not []byte", elem.Value[0])
+	}
+	bytesPerSample := bitsAllocated / 8
+	bytesPerFrame := rows * cols * samplesPerPixel * bytesPerSample
+	if bytesPerFrame <= 0 {
+		return nil, fmt.Errorf("native PixelData: invalid frame geometry (rows=%d, cols=%d, samplesPerPixel=%d, bitsAllocated=%d)", rows, cols, samplesPerPixel, bitsAllocated)
+	}
+	var frames []*frame.Frame
+	for offset := 0; offset+bytesPerFrame <= len(data); offset += bytesPerFrame {
+		frames = append(frames, &frame.Frame{
+			Native: frame.NativeFrame{
+				Data:            decodeNativeSamples(data[offset:offset+bytesPerFrame], cols*samplesPerPixel, bytesPerSample, endian),
+				Rows:            rows,
+				Cols:            cols,
+				SamplesPerPixel: samplesPerPixel,
+				BitsPerSample:   bitsAllocated,
+			},
+		})
+	}
+	return frames, nil
+}
+
+// decodeNativeSamples decodes "raw" (bytesPerSample bytes per sample, in
+// "endian" byte order) into Rows rows of samplesPerRow samples each.
+func decodeNativeSamples(raw []byte, samplesPerRow, bytesPerSample int, endian binary.ByteOrder) [][]int {
+	rowBytes := samplesPerRow * bytesPerSample
+	var rows [][]int
+	for offset := 0; offset+rowBytes <= len(raw); offset += rowBytes {
+		row := make([]int, samplesPerRow)
+		for i := 0; i < samplesPerRow; i++ {
+			start := offset + i*bytesPerSample
+			switch {
+			case bytesPerSample == 1:
+				row[i] = int(raw[start])
+			case bytesPerSample == 2:
+				row[i] = int(endian.Uint16(raw[start : start+2]))
+			case bytesPerSample == 4:
+				row[i] = int(endian.Uint32(raw[start : start+4]))
+			default:
+				var v uint32
+				for b := 0; b < bytesPerSample; b++ {
+					shift := 8 * b
+					if endian == binary.BigEndian {
+						shift = 8 * (bytesPerSample - 1 - b)
+					}
+					v |= uint32(raw[start+b]) << uint(shift)
+				}
+				row[i] = int(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// extractEncapsulatedFrames splits an encapsulated (compressed) PixelData
+// element into frames along DICOM item boundaries, using the Basic Offset
+// Table (the first item) when it's populated.
+func extractEncapsulatedFrames(elem *DicomElement, transferSyntaxUID string) ([]*frame.Frame, error) {
+	items := make([][]byte, 0, len(elem.Value))
+	for _, v := range elem.Value {
+		item, ok := v.(*DicomElement)
+		if !ok || len(item.Value) == 0 {
+			continue
+		}
+		data, ok := item.Value[0].([]byte)
+		if !ok {
+			return nil, fmt.Errorf("encapsulated PixelData: item value is %T, not []byte", item.Value[0])
+		}
+		items = append(items, data)
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	bot := items[0]
+	itemFrames := items[1:]
+
+	var offsets []uint32
+	for offset := 0; offset+4 <= len(bot); offset += 4 {
+		offsets = append(offsets, binary.LittleEndian.Uint32(bot[offset:offset+4]))
+	}
+
+	mimeType := mimeTypeForTransferSyntax(transferSyntaxUID)
+	var frames []*frame.Frame
+	if len(offsets) > 0 {
+		// BOT is populated: the items after it form one contiguous
+		// stream of compressed bytes, split at the given offsets.
+		joined := bytes.Join(itemFrames, nil)
+		for i, off := range offsets {
+			end := uint32(len(joined))
+			if i+1 < len(offsets) {
+				end = offsets[i+1]
+			}
+			if off > uint32(len(joined)) || end > uint32(len(joined)) || off > end {
+				return nil, fmt.Errorf("encapsulated PixelData: Basic Offset Table entry out of range")
+			}
+			frames = append(frames, &frame.Frame{
+				IsEncapsulated: true,
+				Encapsulated: frame.EncapsulatedFrame{
+					Data:              joined[off:end],
+					MIMEType:          mimeType,
+					TransferSyntaxUID: transferSyntaxUID,
+				},
+			})
+		}
+		return frames, nil
+	}
+	// No usable BOT: treat each item after it as a single frame.
+	for _, data := range itemFrames {
+		frames = append(frames, &frame.Frame{
+			IsEncapsulated: true,
+			Encapsulated: frame.EncapsulatedFrame{
+				Data:              data,
+				MIMEType:          mimeType,
+				TransferSyntaxUID: transferSyntaxUID,
+			},
+		})
+	}
+	return frames, nil
+}
+
+// mimeTypeForTransferSyntax returns a best-effort MIME type for the
+// compressed bytes found under a given encapsulated transfer syntax UID, or
+// "" if unknown.
+func mimeTypeForTransferSyntax(uid string) string {
+	switch uid {
+	case "1.2.840.10008.1.2.4.50", "1.2.840.10008.1.2.4.51", "1.2.840.10008.1.2.4.70":
+		return "image/jpeg"
+	case "1.2.840.10008.1.2.4.90", "1.2.840.10008.1.2.4.91":
+		return "image/jp2"
+	case "1.2.840.10008.1.2.5":
+		return "image/x-dicom-rle"
+	default:
+		return ""
+	}
+}
+
+// lookupIntElement looks up "tag" in "elems" and returns its sole value as
+// an int, regardless of whether it was decoded as a uint16 (VR=US) or
+// uint32 (VR=UL).
+func lookupIntElement(elems []DicomElement, tag Tag) (int, error) {
+	elem, err := LookupElementByTag(elems, tag)
+	if err != nil {
+		return 0, err
+	}
+	if len(elem.Value) == 0 {
+		return 0, fmt.Errorf("tag %s has no value", tag.String())
+	}
+	switch v := elem.Value[0].(type) {
+	case uint16:
+		return int(v), nil
+	case uint32:
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("tag %s has unexpected value type %T", tag.String(), v)
+	}
+}
+
 func doassert(x bool) {
 	if !x {
 		panic("doassert")
@@ -0,0 +1,164 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseWithOptionsDropsPixelDataWithoutMaterializing(t *testing.T) {
+	pixels := make([]byte, 4096)
+	for i := range pixels {
+		pixels[i] = byte(i)
+	}
+	original := &DicomFile{
+		Elements: []DicomElement{
+			{Tag: TagTransferSyntaxUID, Vr: "UI", Value: []interface{}{ExplicitVRLittleEndian}},
+			{Tag: Tag{Group: 0x0008, Element: 0x0060}, Vr: "CS", Value: []interface{}{"CT"}},
+			{Tag: TagPixelData, Vr: "OW", Value: []interface{}{pixels}},
+		},
+	}
+	raw, err := WriteBytes(original, nil)
+	if err != nil {
+		t.Fatalf("WriteBytes: %v", err)
+	}
+
+	parsed, err := ParseWithOptions(bytes.NewReader(raw), int64(len(raw)), &ParseOptions{DropPixelData: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions: %v", err)
+	}
+	if _, err := LookupElementByTag(parsed.Elements, TagPixelData); err == nil {
+		t.Error("PixelData should not be present in Elements when DropPixelData is set")
+	}
+	modality, err := LookupElementByTag(parsed.Elements, Tag{Group: 0x0008, Element: 0x0060})
+	if err != nil || modality.Value[0] != "CT" {
+		t.Errorf("Modality lookup after DropPixelData: elem=%v, err=%v", modality, err)
+	}
+}
+
+func TestDecodeNativeSamples(t *testing.T) {
+	// Two rows of two 16-bit samples each: 1,2 / 3,4.
+	little := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	got := decodeNativeSamples(little, 2, 2, binary.LittleEndian)
+	want := [][]int{{1, 2}, {3, 4}}
+	if !rowsEqual(got, want) {
+		t.Errorf("little-endian: got %v, want %v", got, want)
+	}
+
+	big := []byte{0, 1, 0, 2, 0, 3, 0, 4}
+	got = decodeNativeSamples(big, 2, 2, binary.BigEndian)
+	if !rowsEqual(got, want) {
+		t.Errorf("big-endian: got %v, want %v", got, want)
+	}
+}
+
+func rowsEqual(a, b [][]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestExtractNativeFramesSplitsOnFrameBoundary(t *testing.T) {
+	// 2 frames of 2x2, 1 sample per pixel, 8 bits allocated: 4 bytes/frame.
+	elem := &DicomElement{
+		Tag: TagPixelData,
+		Vr:  "OW",
+		Value: []interface{}{
+			[]byte{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+	}
+	frames, err := extractNativeFrames(elem, 2, 2, 1, 8, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("extractNativeFrames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	if got, want := frames[0].Native.Data, [][]int{{1, 2}, {3, 4}}; !rowsEqual(got, want) {
+		t.Errorf("frame 0 = %v, want %v", got, want)
+	}
+	if got, want := frames[1].Native.Data, [][]int{{5, 6}, {7, 8}}; !rowsEqual(got, want) {
+		t.Errorf("frame 1 = %v, want %v", got, want)
+	}
+}
+
+func TestExtractNativeFramesInvalidGeometry(t *testing.T) {
+	elem := &DicomElement{Tag: TagPixelData, Vr: "OW", Value: []interface{}{[]byte{1, 2}}}
+	if _, err := extractNativeFrames(elem, 0, 0, 1, 8, binary.LittleEndian); err == nil {
+		t.Error("expected an error for zero rows/cols, got nil")
+	}
+}
+
+func TestExtractEncapsulatedFramesWithBasicOffsetTable(t *testing.T) {
+	bot := make([]byte, 8)
+	binary.LittleEndian.PutUint32(bot[0:4], 0)
+	binary.LittleEndian.PutUint32(bot[4:8], 3)
+	frame0 := []byte{0xAA, 0xBB, 0xCC}
+	frame1 := []byte{0xDD, 0xEE}
+
+	elem := &DicomElement{
+		Tag: TagPixelData,
+		Vr:  "OB",
+		Vl:  UndefinedLength,
+		Value: []interface{}{
+			&DicomElement{Tag: TagItem, Value: []interface{}{bot}},
+			&DicomElement{Tag: TagItem, Value: []interface{}{frame0}},
+			&DicomElement{Tag: TagItem, Value: []interface{}{frame1}},
+		},
+	}
+
+	frames, err := extractEncapsulatedFrames(elem, "1.2.840.10008.1.2.4.50")
+	if err != nil {
+		t.Fatalf("extractEncapsulatedFrames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	if string(frames[0].Encapsulated.Data) != string(frame0) {
+		t.Errorf("frame 0 data = %v, want %v", frames[0].Encapsulated.Data, frame0)
+	}
+	if string(frames[1].Encapsulated.Data) != string(frame1) {
+		t.Errorf("frame 1 data = %v, want %v", frames[1].Encapsulated.Data, frame1)
+	}
+	if frames[0].Encapsulated.MIMEType != "image/jpeg" {
+		t.Errorf("MIMEType = %q, want image/jpeg", frames[0].Encapsulated.MIMEType)
+	}
+}
+
+func TestExtractEncapsulatedFramesWithoutBasicOffsetTable(t *testing.T) {
+	frame0 := []byte{0x01}
+	frame1 := []byte{0x02}
+
+	elem := &DicomElement{
+		Tag: TagPixelData,
+		Vr:  "OB",
+		Vl:  UndefinedLength,
+		Value: []interface{}{
+			&DicomElement{Tag: TagItem, Value: []interface{}{[]byte{}}}, // empty BOT
+			&DicomElement{Tag: TagItem, Value: []interface{}{frame0}},
+			&DicomElement{Tag: TagItem, Value: []interface{}{frame1}},
+		},
+	}
+
+	frames, err := extractEncapsulatedFrames(elem, "1.2.840.10008.1.2.4.50")
+	if err != nil {
+		t.Fatalf("extractEncapsulatedFrames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	if string(frames[0].Encapsulated.Data) != string(frame0) || string(frames[1].Encapsulated.Data) != string(frame1) {
+		t.Errorf("frames = %v, %v; want %v, %v", frames[0].Encapsulated.Data, frames[1].Encapsulated.Data, frame0, frame1)
+	}
+}
@@ -0,0 +1,128 @@
+package dicom
+
+import "fmt"
+
+// tagDictEntry is a minimal PS3.6 data-dictionary entry: the VR and
+// keyword DICOM defines for a standard (non-private) tag.
+type tagDictEntry struct {
+	Tag  Tag
+	VR   string
+	Name string
+}
+
+// tagDictionary covers the tags this package's own parsing/writing/
+// frame-splitting logic needs to resolve by tag or by name, plus enough of
+// the PS3.6 Patient/General Study/General Series/General Equipment/Image
+// Pixel/SOP Common modules that an ImplicitVR dataset's common elements
+// decode as their real VR instead of falling back to unknownTagVR. It is
+// still not a full PS3.6 dictionary.
+var tagDictionary = []tagDictEntry{
+	{TagTransferSyntaxUID, "UI", "TransferSyntaxUID"},
+	{TagSpecificCharacterSet, "CS", "SpecificCharacterSet"},
+	{TagSamplesPerPixel, "US", "SamplesPerPixel"},
+	{TagRows, "US", "Rows"},
+	{TagColumns, "US", "Columns"},
+	{TagBitsAllocated, "US", "BitsAllocated"},
+	{TagPixelData, "OW", "PixelData"},
+
+	// SOP Common (PS3.3 C.12.1)
+	{Tag{0x0008, 0x0016}, "UI", "SOPClassUID"},
+	{Tag{0x0008, 0x0018}, "UI", "SOPInstanceUID"},
+
+	// General Study / General Series (PS3.3 C.7.2, C.7.3)
+	{Tag{0x0008, 0x0020}, "DA", "StudyDate"},
+	{Tag{0x0008, 0x0021}, "DA", "SeriesDate"},
+	{Tag{0x0008, 0x0030}, "TM", "StudyTime"},
+	{Tag{0x0008, 0x0031}, "TM", "SeriesTime"},
+	{Tag{0x0008, 0x0050}, "SH", "AccessionNumber"},
+	{Tag{0x0008, 0x0060}, "CS", "Modality"},
+	{Tag{0x0008, 0x0070}, "LO", "Manufacturer"},
+	{Tag{0x0008, 0x0080}, "LO", "InstitutionName"},
+	{Tag{0x0008, 0x0090}, "PN", "ReferringPhysicianName"},
+	{Tag{0x0008, 0x1030}, "LO", "StudyDescription"},
+	{Tag{0x0008, 0x103E}, "LO", "SeriesDescription"},
+	{Tag{0x0008, 0x1090}, "LO", "ManufacturerModelName"},
+	{Tag{0x0020, 0x000D}, "UI", "StudyInstanceUID"},
+	{Tag{0x0020, 0x000E}, "UI", "SeriesInstanceUID"},
+	{Tag{0x0020, 0x0010}, "SH", "StudyID"},
+	{Tag{0x0020, 0x0011}, "IS", "SeriesNumber"},
+	{Tag{0x0020, 0x0013}, "IS", "InstanceNumber"},
+
+	// Patient (PS3.3 C.7.1.1)
+	{Tag{0x0010, 0x0010}, "PN", "PatientName"},
+	{Tag{0x0010, 0x0020}, "LO", "PatientID"},
+	{Tag{0x0010, 0x0030}, "DA", "PatientBirthDate"},
+	{Tag{0x0010, 0x0040}, "CS", "PatientSex"},
+
+	// Image Pixel (PS3.3 C.7.6.3), beyond the tags already above
+	{Tag{0x0028, 0x0004}, "CS", "PhotometricInterpretation"},
+	{Tag{0x0028, 0x0101}, "US", "BitsStored"},
+	{Tag{0x0028, 0x0102}, "US", "HighBit"},
+	{Tag{0x0028, 0x0103}, "US", "PixelRepresentation"},
+
+	// General Equipment (PS3.3 C.7.5.1)
+	{Tag{0x0018, 0x1000}, "LO", "DeviceSerialNumber"},
+	{Tag{0x0018, 0x1020}, "LO", "SoftwareVersions"},
+}
+
+var tagDictionaryByTag = func() map[Tag]tagDictEntry {
+	m := make(map[Tag]tagDictEntry, len(tagDictionary))
+	for _, e := range tagDictionary {
+		m[e.Tag] = e
+	}
+	return m
+}()
+
+// LookupTagByTag returns the dictionary entry for "tag", or an error if
+// "tag" is private or otherwise not one this package's dictionary knows
+// about.
+func LookupTagByTag(tag Tag) (tagDictEntry, error) {
+	e, ok := tagDictionaryByTag[tag]
+	if !ok {
+		return tagDictEntry{}, fmt.Errorf("could not find tag %s in dictionary", tag.String())
+	}
+	return e, nil
+}
+
+// LookupTagByName returns the dictionary entry for the element named
+// "name" (e.g. "TransferSyntaxUID"), as used by LookupElementByName.
+func LookupTagByName(name string) (tagDictEntry, error) {
+	for _, e := range tagDictionary {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return tagDictEntry{}, fmt.Errorf("could not find tag named '%s' in dictionary", name)
+}
+
+// UID is a minimal PS3.6 UID dictionary entry.
+type UID struct {
+	UID  string
+	Name string
+	Type string
+}
+
+// UID Type values this package cares about (PS3.6 Table A-1's "UID Type"
+// column has many more; transfer syntax is the only one this package acts
+// on).
+const (
+	UIDTypeTransferSyntax = "Transfer Syntax"
+	UIDTypeSOPClass       = "SOP Class"
+)
+
+var uidDictionary = map[string]UID{
+	ImplicitVRLittleEndian:         {ImplicitVRLittleEndian, "Implicit VR Little Endian", UIDTypeTransferSyntax},
+	ExplicitVRLittleEndian:         {ExplicitVRLittleEndian, "Explicit VR Little Endian", UIDTypeTransferSyntax},
+	ExplicitVRBigEndian:            {ExplicitVRBigEndian, "Explicit VR Big Endian", UIDTypeTransferSyntax},
+	DeflatedExplicitVRLittleEndian: {DeflatedExplicitVRLittleEndian, "Deflated Explicit VR Little Endian", UIDTypeTransferSyntax},
+	"1.2.840.10008.1.2.4.50":       {"1.2.840.10008.1.2.4.50", "JPEG Baseline (Process 1)", UIDTypeTransferSyntax},
+}
+
+// LookupUID returns the dictionary entry for a standard PS3.6 UID.
+func LookupUID(uid string) (UID, error) {
+	e, ok := uidDictionary[uid]
+	if !ok {
+		return UID{}, fmt.Errorf("could not find UID '%s' in dictionary", uid)
+	}
+	return e, nil
+}
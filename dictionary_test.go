@@ -0,0 +1,43 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// TestImplicitVRResolvesCommonStandardTags guards against the dictionary
+// fallback regression where ordinary standard elements (not just the
+// handful this package reads directly) decode as raw unknownTagVR bytes
+// under Implicit VR just because the dictionary didn't carry an entry for
+// them.
+func TestImplicitVRResolvesCommonStandardTags(t *testing.T) {
+	patientName := Tag{Group: 0x0010, Element: 0x0010}
+	entry, err := LookupTagByTag(patientName)
+	if err != nil {
+		t.Fatalf("LookupTagByTag(PatientName): %v", err)
+	}
+	if entry.VR != "PN" {
+		t.Errorf("PatientName VR = %q, want PN", entry.VR)
+	}
+
+	value := []byte("Doe^Jane")
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, patientName.Group)
+	binary.Write(&buf, binary.LittleEndian, patientName.Element)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+	dataset := buf.Bytes()
+
+	d := NewDecoder(bytes.NewReader(dataset), int64(len(dataset)), binary.LittleEndian, ImplicitVR)
+	elem := ReadDataElement(d)
+	if d.Error() != nil {
+		t.Fatalf("ReadDataElement: %v", d.Error())
+	}
+	if elem.Vr != "PN" {
+		t.Errorf("decoded VR = %q, want PN (dictionary fallback regression)", elem.Vr)
+	}
+	if got, want := elem.Value[0].(string), "Doe^Jane"; got != want {
+		t.Errorf("decoded value = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package dicom
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Parser is a pull-style, non-blocking element iterator over a DICOM
+// stream. Unlike Parse/ParseWithOptions, which eagerly read the whole
+// dataset into a DicomFile, Parser lets a caller read one element at a time
+// via ParseNext without forcing everything into memory first, which
+// matters for very large (multi-GB) datasets.
+//
+// Parser does not support ParseOptions.FrameChannel: a pull-style caller
+// already controls its own read loop, so there's nothing for a push-style
+// channel to add.
+type Parser struct {
+	buffer            *Decoder
+	opts              *ParseOptions
+	metaElems         []DicomElement
+	transferSyntaxUID string
+	done              bool
+}
+
+// NewParser reads and validates the file meta header of the stream in "r"
+// (up to "size" bytes), establishes the dataset's transfer syntax, and
+// returns a Parser positioned at the first data element. "opts" (which may
+// be nil) has the same meaning as in ParseWithOptions.
+func NewParser(r io.Reader, size int64, opts *ParseOptions) (*Parser, error) {
+	buffer := NewDecoder(r, size, binary.LittleEndian, ExplicitVR)
+	buffer.SetUnknownTagVR(opts.unknownTagVR())
+	if opts != nil && opts.DropPixelData {
+		buffer.SetDropPixelData(true)
+	}
+	metaElems := ParseFileHeader(buffer)
+	if buffer.Error() != nil {
+		return nil, buffer.Error()
+	}
+
+	var endian binary.ByteOrder
+	var implicit bool
+	var transferSyntaxUID string
+	if elem, err := LookupElementByTag(metaElems, TagTransferSyntaxUID); err == nil {
+		transferSyntaxUID, err = elem.GetString()
+		if err != nil {
+			return nil, err
+		}
+		endian, implicit, err = ParseTransferSyntaxUID(transferSyntaxUID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var inferErr error
+		endian, implicit, transferSyntaxUID, inferErr = inferTransferSyntax(buffer)
+		if inferErr != nil {
+			return nil, inferErr
+		}
+	}
+	buffer.PushTransferSyntax(endian, implicit)
+
+	return &Parser{
+		buffer:            buffer,
+		opts:              opts,
+		metaElems:         metaElems,
+		transferSyntaxUID: transferSyntaxUID,
+	}, nil
+}
+
+// MetaElements returns the file meta group ((0002,xxxx)) elements read by
+// NewParser.
+func (p *Parser) MetaElements() []DicomElement {
+	return p.metaElems
+}
+
+// TransferSyntaxUID returns the transfer syntax UID governing the dataset,
+// whether it came from the file meta header or was inferred.
+func (p *Parser) TransferSyntaxUID() string {
+	return p.transferSyntaxUID
+}
+
+// ParseNext returns the next data element in the stream, applying
+// ParseOptions.DropPixelData, ParseOptions.ReturnTags, and
+// ParseOptions.StopAtTag exactly as ParseWithOptions does, and returns
+// io.EOF once the dataset is exhausted.
+func (p *Parser) ParseNext() (*DicomElement, error) {
+	for {
+		if p.done || p.buffer.Len() <= 0 {
+			p.finish()
+			return nil, io.EOF
+		}
+		elem := ReadDataElement(p.buffer)
+		if err := p.buffer.Error(); err != nil {
+			p.finish()
+			return nil, err
+		}
+		if p.opts != nil && p.opts.StopAtTag != (Tag{}) && tagGreaterOrEqual(elem.Tag, p.opts.StopAtTag) {
+			p.finish()
+			return nil, io.EOF
+		}
+		if elem.Tag == TagSpecificCharacterSet {
+			cs, err := parseSpecificCharacterSet(elem)
+			if err != nil {
+				p.buffer.SetError(err)
+				p.finish()
+				return nil, err
+			}
+			p.buffer.SetCodingSystem(cs)
+		}
+		if p.opts != nil && p.opts.DropPixelData && elem.Tag == TagPixelData {
+			continue
+		}
+		if !p.opts.shouldReturnTag(elem.Tag) {
+			continue
+		}
+		return elem, nil
+	}
+}
+
+// ParseAll drains the remaining elements via ParseNext and returns a
+// DicomFile with the same shape Parse/ParseWithOptions return: the meta
+// elements followed by everything ParseNext produced.
+func (p *Parser) ParseAll() (*DicomFile, error) {
+	file := &DicomFile{Elements: append([]DicomElement{}, p.metaElems...)}
+	for {
+		elem, err := p.ParseNext()
+		if err == io.EOF {
+			return file, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		file.Elements = append(file.Elements, *elem)
+	}
+}
+
+// finish pops the transfer syntax pushed by NewParser. It's idempotent so
+// that both a natural io.EOF and an early StopAtTag/error return can call
+// it without double-popping.
+func (p *Parser) finish() {
+	if p.done {
+		return
+	}
+	p.done = true
+	p.buffer.PopTransferSyntax()
+}
@@ -0,0 +1,40 @@
+// Package frame defines the per-frame pixel data types produced when a
+// caller has PixelData split into frames via dicom.ParseOptions.FrameChannel.
+package frame
+
+// Frame is a single frame of a (possibly multi-frame) PixelData element.
+// Exactly one of Native or Encapsulated is populated, depending on whether
+// the dataset's transfer syntax uses native or encapsulated (compressed)
+// pixel data encoding.
+type Frame struct {
+	// IsEncapsulated reports which of Native/Encapsulated holds the data.
+	IsEncapsulated bool
+
+	Native       NativeFrame
+	Encapsulated EncapsulatedFrame
+}
+
+// NativeFrame holds one frame of decoded, uncompressed pixel samples.
+type NativeFrame struct {
+	// Data holds one []int per row, each of length Cols*SamplesPerPixel.
+	Data [][]int
+
+	BitsPerSample   int
+	Rows            int
+	Cols            int
+	SamplesPerPixel int
+}
+
+// EncapsulatedFrame holds one frame of compressed pixel data exactly as it
+// appeared in the PixelData sequence's item, along with a hint about how to
+// decode it.
+type EncapsulatedFrame struct {
+	Data []byte
+
+	// MIMEType is a best-effort hint derived from the dataset's transfer
+	// syntax UID (e.g. "image/jpeg"), or "" if unknown.
+	MIMEType string
+
+	// TransferSyntaxUID is the UID the bytes in Data were encoded with.
+	TransferSyntaxUID string
+}
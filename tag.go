@@ -0,0 +1,29 @@
+package dicom
+
+import "fmt"
+
+// Tag is a pair of <group, element>, the two 16-bit fields that together
+// identify a DICOM data element, e.g. (0008,0018) for SOPInstanceUID.
+type Tag struct {
+	Group   uint16
+	Element uint16
+}
+
+// String renders a tag in the conventional "(GGGG,EEEE)" hex form.
+func (t Tag) String() string {
+	return fmt.Sprintf("(%04x,%04x)", t.Group, t.Element)
+}
+
+// Standard tags this package's parsing/writing/frame-splitting logic
+// refers to directly. The package's partial PS3.6 data dictionary lives in
+// dictionary.go.
+var (
+	TagItem                 = Tag{Group: 0xFFFE, Element: 0xE000}
+	TagTransferSyntaxUID    = Tag{Group: 0x0002, Element: 0x0010}
+	TagSpecificCharacterSet = Tag{Group: 0x0008, Element: 0x0005}
+	TagSamplesPerPixel      = Tag{Group: 0x0028, Element: 0x0002}
+	TagRows                 = Tag{Group: 0x0028, Element: 0x0010}
+	TagColumns              = Tag{Group: 0x0028, Element: 0x0011}
+	TagBitsAllocated        = Tag{Group: 0x0028, Element: 0x0100}
+	TagPixelData            = Tag{Group: 0x7FE0, Element: 0x0010}
+)
@@ -0,0 +1,455 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tagItemDelimitationItem and tagSequenceDelimitationItem mark the end of
+// an undefined-length item or sequence, respectively. They're never
+// preceded by a VR, even under ExplicitVR.
+var (
+	tagItemDelimitationItem     = Tag{Group: 0xFFFE, Element: 0xE00D}
+	tagSequenceDelimitationItem = Tag{Group: 0xFFFE, Element: 0xE0DD}
+	tagFileMetaGroupLength      = Tag{Group: 0x0002, Element: 0x0000}
+)
+
+// WriteOptions controls how Write/WriteBytes serialize a DicomFile back
+// into DICOM Part-10 bytes.
+type WriteOptions struct {
+	// SkipVRVerification, when true, trusts each element's Vr field as-is
+	// instead of rejecting VRs that aren't among the standard PS3.5 6.2
+	// codes. Needed to round-trip files whose elements carry a
+	// nonstandard VR (e.g. ones parsed from a file with no meta header,
+	// where VR had to be guessed).
+	SkipVRVerification bool
+
+	// DefaultMissingTransferSyntax is used to encode the dataset when
+	// "file" has no (0002,0010) TransferSyntaxUID element of its own.
+	// Defaults to ImplicitVRLittleEndian.
+	DefaultMissingTransferSyntax string
+}
+
+// WriteBytes is a shorthand for Write into an in-memory buffer, returning
+// the resulting bytes.
+func WriteBytes(file *DicomFile, opts *WriteOptions) ([]byte, error) {
+	var b bytes.Buffer
+	if err := Write(&b, file, opts); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Write serializes "file" as a DICOM Part-10 stream: a 128-byte preamble,
+// the "DICM" magic, the file meta group ((0002,xxxx), always encoded
+// ExplicitVR LittleEndian, with a freshly computed (0002,0000) group
+// length), followed by the rest of the dataset encoded per the file's
+// declared TransferSyntaxUID.
+func Write(w io.Writer, file *DicomFile, opts *WriteOptions) error {
+	if opts == nil {
+		opts = &WriteOptions{}
+	}
+
+	var metaElems, dataElems []DicomElement
+	for _, elem := range file.Elements {
+		if elem.Tag.Group == 0x0002 {
+			metaElems = append(metaElems, elem)
+		} else {
+			dataElems = append(dataElems, elem)
+		}
+	}
+
+	transferSyntaxUID := opts.DefaultMissingTransferSyntax
+	if transferSyntaxUID == "" {
+		transferSyntaxUID = ImplicitVRLittleEndian
+	}
+	if tsElem, err := LookupElementByTag(metaElems, TagTransferSyntaxUID); err == nil {
+		if uid, err := tsElem.GetString(); err == nil {
+			transferSyntaxUID = uid
+		}
+	}
+	endian, implicit, err := ParseTransferSyntaxUID(transferSyntaxUID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(make([]byte, 128)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "DICM"); err != nil {
+		return err
+	}
+
+	metaEncoder := &encoder{bo: binary.LittleEndian, implicit: false, opts: opts}
+	metaBody := &bytes.Buffer{}
+	for _, elem := range metaElems {
+		if elem.Tag == tagFileMetaGroupLength {
+			continue // recomputed below, once the rest of the group is known
+		}
+		if err := metaEncoder.writeElement(metaBody, &elem); err != nil {
+			return err
+		}
+	}
+	groupLengthElem := &DicomElement{
+		Tag:   tagFileMetaGroupLength,
+		Vr:    "UL",
+		Value: []interface{}{uint32(metaBody.Len())},
+	}
+	if err := metaEncoder.writeElement(w, groupLengthElem); err != nil {
+		return err
+	}
+	if _, err := w.Write(metaBody.Bytes()); err != nil {
+		return err
+	}
+
+	dataEncoder := &encoder{bo: endian, implicit: implicit, opts: opts}
+	for _, elem := range dataElems {
+		if err := dataEncoder.writeElement(w, &elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encoder holds the transfer-syntax state needed to serialize a run of
+// elements (the meta group and the dataset proper each get their own
+// encoder, since they may use different transfer syntaxes).
+type encoder struct {
+	bo       binary.ByteOrder
+	implicit bool
+	opts     *WriteOptions
+}
+
+// writeElement encodes "elem" (tag, VR/length header, and value) to "out".
+func (e *encoder) writeElement(out io.Writer, elem *DicomElement) error {
+	vr, err := e.resolveVR(elem)
+	if err != nil {
+		return fmt.Errorf("tag %s: %v", elem.Tag.String(), err)
+	}
+	body := &bytes.Buffer{}
+	undefinedLength, err := e.writeValue(body, elem, vr)
+	if err != nil {
+		return fmt.Errorf("tag %s: %v", elem.Tag.String(), err)
+	}
+	length := uint32(body.Len())
+	if undefinedLength {
+		length = UndefinedLength
+	}
+	if err := e.writeTagAndVR(out, elem.Tag, vr, length); err != nil {
+		return err
+	}
+	_, err = out.Write(body.Bytes())
+	return err
+}
+
+// resolveVR returns the VR to encode "elem" with, defaulting an empty Vr to
+// "UN" and, unless opts.SkipVRVerification is set, rejecting VRs that
+// aren't among the standard PS3.5 6.2 codes.
+func (e *encoder) resolveVR(elem *DicomElement) (string, error) {
+	vr := elem.Vr
+	if vr == "" {
+		vr = "UN"
+	}
+	if e.opts.SkipVRVerification || isValidVR(vr) {
+		return vr, nil
+	}
+	return "", fmt.Errorf("VR %q is not a standard DICOM VR (set WriteOptions.SkipVRVerification to bypass)", vr)
+}
+
+// writeTagAndVR writes the tag, and then, for ExplicitVR, the VR and the
+// length field sized appropriately for that VR; for ImplicitVR it writes
+// only the tag and a plain 32-bit length.
+func (e *encoder) writeTagAndVR(out io.Writer, tag Tag, vr string, length uint32) error {
+	if err := writeTag(out, e.bo, tag); err != nil {
+		return err
+	}
+	if e.implicit {
+		return binary.Write(out, e.bo, length)
+	}
+	if _, err := out.Write([]byte(vr)); err != nil {
+		return err
+	}
+	switch vr {
+	case "OB", "OW", "OF", "SQ", "UT", "UN":
+		if _, err := out.Write([]byte{0, 0}); err != nil {
+			return err
+		}
+		return binary.Write(out, e.bo, length)
+	default:
+		return binary.Write(out, e.bo, uint16(length))
+	}
+}
+
+func writeTag(out io.Writer, bo binary.ByteOrder, tag Tag) error {
+	if err := binary.Write(out, bo, tag.Group); err != nil {
+		return err
+	}
+	return binary.Write(out, bo, tag.Element)
+}
+
+// writeValue encodes elem.Value into "body" according to "vr", reporting
+// whether the element's length should be written as UndefinedLength (true
+// for sequences that were parsed with an undefined length, and for
+// encapsulated PixelData).
+func (e *encoder) writeValue(body *bytes.Buffer, elem *DicomElement, vr string) (bool, error) {
+	switch vr {
+	case "SQ":
+		return e.writeSequence(body, elem)
+	case "OB", "OW", "OF", "UN":
+		if elem.Vl == UndefinedLength {
+			return e.writeEncapsulatedPixelData(body, elem)
+		}
+		if len(elem.Value) != 1 {
+			return false, fmt.Errorf("expected a single raw value for VR %s, got %d", vr, len(elem.Value))
+		}
+		data, ok := elem.Value[0].([]byte)
+		if !ok {
+			return false, fmt.Errorf("expected []byte for VR %s, got %T", vr, elem.Value[0])
+		}
+		_, err := body.Write(data)
+		return false, err
+	case "LT", "ST", "UT":
+		if len(elem.Value) != 1 {
+			return false, fmt.Errorf("expected a single value for VR %s, got %d", vr, len(elem.Value))
+		}
+		data, ok := elem.Value[0].([]byte)
+		if !ok {
+			s, ok := elem.Value[0].(string)
+			if !ok {
+				return false, fmt.Errorf("expected []byte or string for VR %s, got %T", vr, elem.Value[0])
+			}
+			data = []byte(s)
+		}
+		if len(data)%2 != 0 {
+			data = append(data, ' ')
+		}
+		_, err := body.Write(data)
+		return false, err
+	case "AT":
+		for _, v := range elem.Value {
+			t, ok := v.(Tag)
+			if !ok {
+				return false, fmt.Errorf("expected Tag for VR AT, got %T", v)
+			}
+			if err := writeTag(body, e.bo, t); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	case "US":
+		return false, e.writeUint16Values(body, elem.Value)
+	case "UL":
+		return false, e.writeUint32Values(body, elem.Value)
+	case "SS":
+		return false, e.writeInt16Values(body, elem.Value)
+	case "SL":
+		return false, e.writeInt32Values(body, elem.Value)
+	case "FL":
+		return false, e.writeFloat32Values(body, elem.Value)
+	case "FD":
+		return false, e.writeFloat64Values(body, elem.Value)
+	default:
+		return false, e.writeStringValue(body, elem, vr)
+	}
+}
+
+func (e *encoder) writeUint16Values(body *bytes.Buffer, values []interface{}) error {
+	for _, v := range values {
+		x, ok := v.(uint16)
+		if !ok {
+			return fmt.Errorf("expected uint16, got %T", v)
+		}
+		if err := binary.Write(body, e.bo, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) writeUint32Values(body *bytes.Buffer, values []interface{}) error {
+	for _, v := range values {
+		x, ok := v.(uint32)
+		if !ok {
+			return fmt.Errorf("expected uint32, got %T", v)
+		}
+		if err := binary.Write(body, e.bo, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) writeInt16Values(body *bytes.Buffer, values []interface{}) error {
+	for _, v := range values {
+		x, ok := v.(int16)
+		if !ok {
+			return fmt.Errorf("expected int16, got %T", v)
+		}
+		if err := binary.Write(body, e.bo, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) writeInt32Values(body *bytes.Buffer, values []interface{}) error {
+	for _, v := range values {
+		x, ok := v.(int32)
+		if !ok {
+			return fmt.Errorf("expected int32, got %T", v)
+		}
+		if err := binary.Write(body, e.bo, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) writeFloat32Values(body *bytes.Buffer, values []interface{}) error {
+	for _, v := range values {
+		x, ok := v.(float32)
+		if !ok {
+			return fmt.Errorf("expected float32, got %T", v)
+		}
+		if err := binary.Write(body, e.bo, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) writeFloat64Values(body *bytes.Buffer, values []interface{}) error {
+	for _, v := range values {
+		x, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("expected float64, got %T", v)
+		}
+		if err := binary.Write(body, e.bo, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStringValue joins elem.Value (each expected to be a string) with the
+// standard "\" value delimiter, padding to an even length as PS3.5 6.4
+// requires ("\x00" for VR UI, a space otherwise).
+func (e *encoder) writeStringValue(body *bytes.Buffer, elem *DicomElement, vr string) error {
+	strs := make([]string, 0, len(elem.Value))
+	for _, v := range elem.Value {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected string for VR %s, got %T", vr, v)
+		}
+		strs = append(strs, s)
+	}
+	joined := strings.Join(strs, "\\")
+	if len(joined)%2 != 0 {
+		if vr == "UI" {
+			joined += "\x00"
+		} else {
+			joined += " "
+		}
+	}
+	_, err := body.WriteString(joined)
+	return err
+}
+
+// writeEncapsulatedPixelData encodes a compressed PixelData element's
+// items (the Basic Offset Table followed by one item per frame, per
+// PS3.5 A.4) and always reports an undefined length, mirroring the
+// Decoder.readEncapsulatedPixelData it round-trips.
+func (e *encoder) writeEncapsulatedPixelData(body *bytes.Buffer, elem *DicomElement) (bool, error) {
+	for _, v := range elem.Value {
+		item, ok := v.(*DicomElement)
+		if !ok {
+			return false, fmt.Errorf("expected *DicomElement item for encapsulated PixelData, got %T", v)
+		}
+		if len(item.Value) != 1 {
+			return false, fmt.Errorf("expected a single raw value for encapsulated PixelData item, got %d", len(item.Value))
+		}
+		data, ok := item.Value[0].([]byte)
+		if !ok {
+			return false, fmt.Errorf("expected []byte for encapsulated PixelData item, got %T", item.Value[0])
+		}
+		if err := writeTag(body, e.bo, TagItem); err != nil {
+			return false, err
+		}
+		if err := binary.Write(body, e.bo, uint32(len(data))); err != nil {
+			return false, err
+		}
+		if _, err := body.Write(data); err != nil {
+			return false, err
+		}
+	}
+	if err := e.writeDelimitationTag(body, tagSequenceDelimitationItem); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeSequence encodes each item in a SQ element's Value, followed by a
+// SequenceDelimitationItem if the element was parsed with an undefined
+// length.
+func (e *encoder) writeSequence(body *bytes.Buffer, elem *DicomElement) (bool, error) {
+	for _, v := range elem.Value {
+		item, ok := v.(*DicomElement)
+		if !ok {
+			return false, fmt.Errorf("expected *DicomElement item for VR SQ, got %T", v)
+		}
+		if err := e.writeItem(body, item); err != nil {
+			return false, err
+		}
+	}
+	if elem.Vl == UndefinedLength {
+		if err := e.writeDelimitationTag(body, tagSequenceDelimitationItem); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// writeItem encodes one SQ item: an Item tag, a length (defined, or
+// undefined followed by an ItemDelimitationItem), and the item's nested
+// elements.
+func (e *encoder) writeItem(out io.Writer, item *DicomElement) error {
+	itemBody := &bytes.Buffer{}
+	for _, v := range item.Value {
+		nested, ok := v.(*DicomElement)
+		if !ok {
+			return fmt.Errorf("expected *DicomElement inside item, got %T", v)
+		}
+		if err := e.writeElement(itemBody, nested); err != nil {
+			return err
+		}
+	}
+	undefined := item.Vl == UndefinedLength
+	length := uint32(itemBody.Len())
+	if undefined {
+		length = UndefinedLength
+	}
+	if err := writeTag(out, e.bo, TagItem); err != nil {
+		return err
+	}
+	if err := binary.Write(out, e.bo, length); err != nil {
+		return err
+	}
+	if _, err := out.Write(itemBody.Bytes()); err != nil {
+		return err
+	}
+	if undefined {
+		return e.writeDelimitationTag(out, tagItemDelimitationItem)
+	}
+	return nil
+}
+
+func (e *encoder) writeDelimitationTag(out io.Writer, tag Tag) error {
+	if err := writeTag(out, e.bo, tag); err != nil {
+		return err
+	}
+	return binary.Write(out, e.bo, uint32(0))
+}
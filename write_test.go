@@ -0,0 +1,134 @@
+package dicom
+
+import "testing"
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	original := &DicomFile{
+		Elements: []DicomElement{
+			{Tag: TagTransferSyntaxUID, Vr: "UI", Value: []interface{}{ExplicitVRLittleEndian}},
+			{Tag: Tag{Group: 0x0010, Element: 0x0010}, Vr: "PN", Value: []interface{}{"Doe^John"}},
+			{Tag: TagRows, Vr: "US", Value: []interface{}{uint16(512)}},
+			{Tag: Tag{Group: 0x0008, Element: 0x0060}, Vr: "CS", Value: []interface{}{"CT"}},
+		},
+	}
+
+	raw, err := WriteBytes(original, nil)
+	if err != nil {
+		t.Fatalf("WriteBytes: %v", err)
+	}
+
+	parsed, err := ParseBytes(raw)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+
+	patientNameTag := Tag{Group: 0x0010, Element: 0x0010}
+	patientName, err := LookupElementByTag(parsed.Elements, patientNameTag)
+	if err != nil {
+		t.Fatalf("lookup PatientName: %v", err)
+	}
+	if got, err := patientName.GetString(); err != nil || got != "Doe^John" {
+		t.Errorf("PatientName = %q, err=%v; want \"Doe^John\", nil", got, err)
+	}
+
+	rows, err := LookupElementByTag(parsed.Elements, TagRows)
+	if err != nil {
+		t.Fatalf("lookup Rows: %v", err)
+	}
+	if len(rows.Value) != 1 || rows.Value[0] != uint16(512) {
+		t.Errorf("Rows = %v; want [512]", rows.Value)
+	}
+
+	modality, err := LookupElementByTag(parsed.Elements, Tag{Group: 0x0008, Element: 0x0060})
+	if err != nil {
+		t.Fatalf("lookup Modality: %v", err)
+	}
+	if got, err := modality.GetString(); err != nil || got != "CT" {
+		t.Errorf("Modality = %q, err=%v; want \"CT\", nil", got, err)
+	}
+}
+
+// TestWriteParseRoundTripImplicitVR exercises the other half of
+// writeTagAndVR/ReadDataElement: ImplicitVR encodes only a tag and a plain
+// 32-bit length, relying on the data dictionary (or UnknownTagVR) to
+// recover the VR on the way back in.
+func TestWriteParseRoundTripImplicitVR(t *testing.T) {
+	original := &DicomFile{
+		Elements: []DicomElement{
+			{Tag: TagTransferSyntaxUID, Vr: "UI", Value: []interface{}{ImplicitVRLittleEndian}},
+			{Tag: TagSamplesPerPixel, Vr: "US", Value: []interface{}{uint16(1)}},
+		},
+	}
+
+	raw, err := WriteBytes(original, nil)
+	if err != nil {
+		t.Fatalf("WriteBytes: %v", err)
+	}
+
+	parsed, err := ParseBytes(raw)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+
+	samplesPerPixel, err := LookupElementByTag(parsed.Elements, TagSamplesPerPixel)
+	if err != nil {
+		t.Fatalf("lookup SamplesPerPixel: %v", err)
+	}
+	if len(samplesPerPixel.Value) != 1 || samplesPerPixel.Value[0] != uint16(1) {
+		t.Errorf("SamplesPerPixel = %v; want [1]", samplesPerPixel.Value)
+	}
+}
+
+// TestWriteParseRoundTripEncapsulatedPixelData covers the write path for
+// compressed PixelData, whose Value is a slice of Item DicomElements
+// (Basic Offset Table + one item per frame) rather than a single []byte,
+// mirroring Decoder.readEncapsulatedPixelData.
+func TestWriteParseRoundTripEncapsulatedPixelData(t *testing.T) {
+	bot := []byte{}
+	frame0 := []byte{0xFF, 0xD8, 0xAA, 0xBB}
+	frame1 := []byte{0xFF, 0xD8, 0xCC}
+
+	original := &DicomFile{
+		Elements: []DicomElement{
+			{Tag: TagTransferSyntaxUID, Vr: "UI", Value: []interface{}{"1.2.840.10008.1.2.4.50"}},
+			{
+				Tag: TagPixelData,
+				Vr:  "OB",
+				Vl:  UndefinedLength,
+				Value: []interface{}{
+					&DicomElement{Tag: TagItem, Vr: "NA", Value: []interface{}{bot}},
+					&DicomElement{Tag: TagItem, Vr: "NA", Value: []interface{}{frame0}},
+					&DicomElement{Tag: TagItem, Vr: "NA", Value: []interface{}{frame1}},
+				},
+			},
+		},
+	}
+
+	raw, err := WriteBytes(original, nil)
+	if err != nil {
+		t.Fatalf("WriteBytes: %v", err)
+	}
+
+	parsed, err := ParseBytes(raw)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+
+	pixelData, err := LookupElementByTag(parsed.Elements, TagPixelData)
+	if err != nil {
+		t.Fatalf("lookup PixelData: %v", err)
+	}
+	frames, err := extractEncapsulatedFrames(pixelData, "1.2.840.10008.1.2.4.50")
+	if err != nil {
+		t.Fatalf("extractEncapsulatedFrames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	if string(frames[0].Encapsulated.Data) != string(frame0) {
+		t.Errorf("frame 0 = %v, want %v", frames[0].Encapsulated.Data, frame0)
+	}
+	if string(frames[1].Encapsulated.Data) != string(frame1) {
+		t.Errorf("frame 1 = %v, want %v", frames[1].Encapsulated.Data, frame1)
+	}
+}